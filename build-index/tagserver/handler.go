@@ -0,0 +1,91 @@
+// Package tagserver exposes tagstore.Store over HTTP.
+package tagserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.uber.internal/infra/kraken/build-index/tagstore"
+	"code.uber.internal/infra/kraken/core/tagref"
+
+	"github.com/gorilla/mux"
+)
+
+// Server serves the tag HTTP API backed by a tagstore.Store.
+type Server struct {
+	store tagstore.Store
+}
+
+// New creates a new Server.
+func New(store tagstore.Store) *Server {
+	return &Server{store}
+}
+
+// Handler returns the set of routes served by s.
+func (s *Server) Handler() http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/tags/{tag:.*}", s.putTagHandler).Methods("PUT")
+	r.HandleFunc("/tags/{tag:.*}", s.getTagHandler).Methods("GET")
+	r.HandleFunc("/tags/{tag:.*}", s.deleteTagHandler).Methods("DELETE")
+	return r
+}
+
+// putTagHandler handles PUT /tags/:tag, with the TagDescriptor to store as
+// the JSON request body. Tag references are validated before they ever
+// reach tagstore, so malformed input is rejected with a 400 instead of
+// being persisted and only failing later on read.
+func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	if _, err := tagref.ParseTagRef(tag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var desc tagstore.TagDescriptor
+	if err := json.NewDecoder(r.Body).Decode(&desc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.store.PutDescriptor(tag, desc, 0); err != nil {
+		if _, ok := err.(*tagref.ErrInvalidTagRef); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// getTagHandler handles GET /tags/:tag.
+func (s *Server) getTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	if _, err := tagref.ParseTagRef(tag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	desc, err := s.store.GetDescriptor(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(desc)
+}
+
+// deleteTagHandler handles DELETE /tags/:tag.
+func (s *Server) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	if _, err := tagref.ParseTagRef(tag); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.store.Delete(tag); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
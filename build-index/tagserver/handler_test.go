@@ -0,0 +1,99 @@
+package tagserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"code.uber.internal/infra/kraken/build-index/tagstore"
+	"code.uber.internal/infra/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore is a minimal tagstore.Store fake for exercising routing and
+// request/response translation, without any disk or backend state.
+type fakeStore struct {
+	tagstore.Store
+
+	descs map[string]tagstore.TagDescriptor
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{descs: make(map[string]tagstore.TagDescriptor)}
+}
+
+func (s *fakeStore) PutDescriptor(tag string, desc tagstore.TagDescriptor, writeBackDelay time.Duration) error {
+	s.descs[tag] = desc
+	return nil
+}
+
+func (s *fakeStore) GetDescriptor(tag string) (tagstore.TagDescriptor, error) {
+	desc, ok := s.descs[tag]
+	if !ok {
+		return tagstore.TagDescriptor{}, tagstore.ErrTagNotFound
+	}
+	return desc, nil
+}
+
+func (s *fakeStore) Delete(tag string) error {
+	if _, ok := s.descs[tag]; !ok {
+		return tagstore.ErrTagNotFound
+	}
+	delete(s.descs, tag)
+	return nil
+}
+
+func TestHandlerRoutesMatchRepositoryTagsWithSlashes(t *testing.T) {
+	require := require.New(t)
+
+	store := newFakeStore()
+	server := httptest.NewServer(New(store).Handler())
+	defer server.Close()
+
+	tag := "library/ubuntu:latest"
+	d := core.DigestFixture()
+	desc := tagstore.NewTagDescriptor(d, "", 0)
+
+	b, err := json.Marshal(desc)
+	require.NoError(err)
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/tags/"+tag, bytes.NewReader(b))
+	require.NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(err)
+	require.Equal(http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/tags/" + tag)
+	require.NoError(err)
+	require.Equal(http.StatusOK, resp.StatusCode)
+
+	var got tagstore.TagDescriptor
+	require.NoError(json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(desc, got)
+
+	req, err = http.NewRequest(http.MethodDelete, server.URL+"/tags/"+tag, nil)
+	require.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(err)
+	require.Equal(http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/tags/" + tag)
+	require.NoError(err)
+	require.Equal(http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHandlerRejectsInvalidTagRefWith400(t *testing.T) {
+	require := require.New(t)
+
+	store := newFakeStore()
+	server := httptest.NewServer(New(store).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tags/" + core.DigestFixture().String())
+	require.NoError(err)
+	require.Equal(http.StatusBadRequest, resp.StatusCode)
+}
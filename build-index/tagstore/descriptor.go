@@ -0,0 +1,67 @@
+package tagstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"code.uber.internal/infra/kraken/core"
+)
+
+// TagDescriptor is the value a tag resolves to. Besides the digest, it
+// carries the media type and size a client would otherwise have to fetch
+// the blob itself to learn.
+type TagDescriptor struct {
+	Digest      core.Digest       `json:"digest"`
+	MediaType   string            `json:"media_type,omitempty"`
+	Size        int64             `json:"size,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NewTagDescriptor creates a new TagDescriptor.
+func NewTagDescriptor(d core.Digest, mediaType string, size int64) TagDescriptor {
+	return TagDescriptor{Digest: d, MediaType: mediaType, Size: size}
+}
+
+func (desc TagDescriptor) marshal() ([]byte, error) {
+	b, err := json.Marshal(desc)
+	if err != nil {
+		return nil, fmt.Errorf("marshal tag descriptor: %s", err)
+	}
+	return b, nil
+}
+
+// unmarshalTagDescriptor parses b as a TagDescriptor. For backward
+// compatibility with tags written before descriptors existed, if b does not
+// begin with a JSON object it is instead parsed as a bare SHA256 digest
+// string and wrapped in a descriptor with an empty media type and size. A
+// JSON object which fails to unmarshal is returned as an error.
+func unmarshalTagDescriptor(b []byte) (TagDescriptor, error) {
+	if looksLikeJSON(b) {
+		var desc TagDescriptor
+		if err := json.Unmarshal(b, &desc); err != nil {
+			return TagDescriptor{}, fmt.Errorf("unmarshal tag descriptor: %s", err)
+		}
+		return desc, nil
+	}
+	d, err := core.ParseSHA256Digest(string(b))
+	if err != nil {
+		return TagDescriptor{}, fmt.Errorf("parse legacy digest: %s", err)
+	}
+	return TagDescriptor{Digest: d}, nil
+}
+
+func looksLikeJSON(b []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(b)), "{")
+}
+
+// readDescriptor drains r and parses it as a TagDescriptor.
+func readDescriptor(r io.Reader) (TagDescriptor, error) {
+	var b bytes.Buffer
+	if _, err := io.Copy(&b, r); err != nil {
+		return TagDescriptor{}, fmt.Errorf("read: %s", err)
+	}
+	return unmarshalTagDescriptor(b.Bytes())
+}
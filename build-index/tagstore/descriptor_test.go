@@ -0,0 +1,36 @@
+package tagstore
+
+import (
+	"testing"
+
+	"code.uber.internal/infra/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagDescriptorRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	d := core.DigestFixture()
+	desc := NewTagDescriptor(d, "application/vnd.docker.distribution.manifest.v2+json", 1234)
+
+	b, err := desc.marshal()
+	require.NoError(err)
+
+	got, err := unmarshalTagDescriptor(b)
+	require.NoError(err)
+	require.Equal(desc, got)
+}
+
+func TestUnmarshalTagDescriptorBackwardCompatible(t *testing.T) {
+	require := require.New(t)
+
+	d := core.DigestFixture()
+
+	// Tags written before descriptors existed are a bare digest string.
+	got, err := unmarshalTagDescriptor([]byte(d.String()))
+	require.NoError(err)
+	require.Equal(d, got.Digest)
+	require.Empty(got.MediaType)
+	require.Zero(got.Size)
+}
@@ -0,0 +1,325 @@
+package tagstore
+
+import (
+	"fmt"
+	"sync"
+
+	"code.uber.internal/infra/kraken/core"
+	"code.uber.internal/infra/kraken/utils/log"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	tagBucket    = []byte("tag")    // tag -> descriptor JSON
+	digestBucket = []byte("digest") // digest -> newline-separated tag set
+)
+
+// TagIndex persists the tag -> descriptor forward map and the digest ->
+// tag-set reverse index. Implementations must apply Put and Delete
+// atomically across both, so the reverse index can never diverge from the
+// forward map, even across a crash.
+type TagIndex interface {
+	Put(tag string, desc TagDescriptor) error
+	Delete(tag string) (TagDescriptor, bool, error)
+	Lookup(d core.Digest) ([]string, error)
+	Tags() ([]string, error)
+	Close() error
+}
+
+// boltTagIndex is a TagIndex backed by a single embedded BoltDB file holding
+// two buckets: tag->descriptor and digest->tagset. Both buckets sit at the
+// top level of the file; there is no enclosing "tagstore" bucket.
+type boltTagIndex struct {
+	db *bolt.DB
+}
+
+// NewBoltTagIndex opens (creating if necessary) a BoltDB-backed TagIndex at
+// path.
+func NewBoltTagIndex(path string) (TagIndex, error) {
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open bolt db: %s", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(tagBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(digestBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create buckets: %s", err)
+	}
+	return &boltTagIndex{db}, nil
+}
+
+func (idx *boltTagIndex) Put(tag string, desc TagDescriptor) error {
+	b, err := desc.marshal()
+	if err != nil {
+		return err
+	}
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		tags := tx.Bucket(tagBucket)
+		digests := tx.Bucket(digestBucket)
+
+		if prev := tags.Get([]byte(tag)); prev != nil {
+			if prevDesc, err := unmarshalTagDescriptor(prev); err == nil && prevDesc.Digest != desc.Digest {
+				if err := removeTagFromSet(digests, prevDesc.Digest, tag); err != nil {
+					return err
+				}
+			}
+		}
+		if err := tags.Put([]byte(tag), b); err != nil {
+			return err
+		}
+		return addTagToSet(digests, desc.Digest, tag)
+	})
+}
+
+func (idx *boltTagIndex) Delete(tag string) (desc TagDescriptor, found bool, err error) {
+	err = idx.db.Update(func(tx *bolt.Tx) error {
+		tags := tx.Bucket(tagBucket)
+		digests := tx.Bucket(digestBucket)
+
+		raw := tags.Get([]byte(tag))
+		if raw == nil {
+			return nil
+		}
+		found = true
+		var err error
+		desc, err = unmarshalTagDescriptor(raw)
+		if err != nil {
+			return err
+		}
+		if err := tags.Delete([]byte(tag)); err != nil {
+			return err
+		}
+		return removeTagFromSet(digests, desc.Digest, tag)
+	})
+	return desc, found, err
+}
+
+func (idx *boltTagIndex) Lookup(d core.Digest) ([]string, error) {
+	var tags []string
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		tags = readTagSet(tx.Bucket(digestBucket), d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// Tags returns every tag currently in the forward map.
+func (idx *boltTagIndex) Tags() ([]string, error) {
+	var tags []string
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tagBucket).ForEach(func(k, v []byte) error {
+			tags = append(tags, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (idx *boltTagIndex) Close() error {
+	return idx.db.Close()
+}
+
+func readTagSet(digests *bolt.Bucket, d core.Digest) []string {
+	raw := digests.Get([]byte(d.String()))
+	if raw == nil {
+		return nil
+	}
+	return splitTagSet(string(raw))
+}
+
+func addTagToSet(digests *bolt.Bucket, d core.Digest, tag string) error {
+	key := []byte(d.String())
+	tags := splitTagSet(string(digests.Get(key)))
+	for _, t := range tags {
+		if t == tag {
+			return nil
+		}
+	}
+	tags = append(tags, tag)
+	return digests.Put(key, []byte(joinTagSet(tags)))
+}
+
+func removeTagFromSet(digests *bolt.Bucket, d core.Digest, tag string) error {
+	key := []byte(d.String())
+	tags := splitTagSet(string(digests.Get(key)))
+	kept := tags[:0]
+	for _, t := range tags {
+		if t != tag {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == 0 {
+		return digests.Delete(key)
+	}
+	return digests.Put(key, []byte(joinTagSet(kept)))
+}
+
+func splitTagSet(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var tags []string
+	start := 0
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '\n' {
+			tags = append(tags, raw[start:i])
+			start = i + 1
+		}
+	}
+	tags = append(tags, raw[start:])
+	return tags
+}
+
+func joinTagSet(tags []string) string {
+	var raw string
+	for i, t := range tags {
+		if i > 0 {
+			raw += "\n"
+		}
+		raw += t
+	}
+	return raw
+}
+
+// memoryTagIndex is an in-memory TagIndex, intended for tests which want to
+// inject a TagIndex via NewWithIndex without standing up a BoltDB file.
+type memoryTagIndex struct {
+	mu      sync.Mutex
+	tags    map[string]TagDescriptor
+	digests map[core.Digest]map[string]bool
+}
+
+// NewMemoryTagIndex creates a new in-memory TagIndex.
+func NewMemoryTagIndex() TagIndex {
+	return &memoryTagIndex{
+		tags:    make(map[string]TagDescriptor),
+		digests: make(map[core.Digest]map[string]bool),
+	}
+}
+
+func (idx *memoryTagIndex) Put(tag string, desc TagDescriptor) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if prev, ok := idx.tags[tag]; ok && prev.Digest != desc.Digest {
+		idx.removeLocked(tag, prev.Digest)
+	}
+	idx.tags[tag] = desc
+	if idx.digests[desc.Digest] == nil {
+		idx.digests[desc.Digest] = make(map[string]bool)
+	}
+	idx.digests[desc.Digest][tag] = true
+	return nil
+}
+
+func (idx *memoryTagIndex) Delete(tag string) (TagDescriptor, bool, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	desc, ok := idx.tags[tag]
+	if !ok {
+		return TagDescriptor{}, false, nil
+	}
+	delete(idx.tags, tag)
+	idx.removeLocked(tag, desc.Digest)
+	return desc, true, nil
+}
+
+func (idx *memoryTagIndex) Lookup(d core.Digest) ([]string, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	tagSet := idx.digests[d]
+	tags := make([]string, 0, len(tagSet))
+	for tag := range tagSet {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// Tags returns every tag currently in the forward map.
+func (idx *memoryTagIndex) Tags() ([]string, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	tags := make([]string, 0, len(idx.tags))
+	for tag := range idx.tags {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (idx *memoryTagIndex) Close() error {
+	return nil
+}
+
+func (idx *memoryTagIndex) removeLocked(tag string, d core.Digest) {
+	tagSet, ok := idx.digests[d]
+	if !ok {
+		return
+	}
+	delete(tagSet, tag)
+	if len(tagSet) == 0 {
+		delete(idx.digests, d)
+	}
+}
+
+// migrateFileStoreCache reconciles idx against fs on startup. Any tag cached
+// in fs but not yet present in the index is added, which allows upgrading an
+// existing deployment from the old one-file-per-tag FileStore cache to the
+// BoltDB-backed TagIndex without losing local state. Conversely, any tag
+// present in idx but no longer in fs is removed from the index, healing a
+// crash between Delete's disk removal and its index update (Put's crash
+// window is already healed by the additive half of this same scan).
+func migrateFileStoreCache(fs FileStore, idx TagIndex) error {
+	names, err := fs.ListCacheFiles()
+	if err != nil {
+		return fmt.Errorf("list cache files: %s", err)
+	}
+	onDisk := make(map[string]bool, len(names))
+	for _, tag := range names {
+		onDisk[tag] = true
+
+		f, err := fs.GetCacheFileReader(tag)
+		if err != nil {
+			log.With("tag", tag).Errorf("Error opening cache file during tag index migration: %s", err)
+			continue
+		}
+		desc, err := readDescriptor(f)
+		f.Close()
+		if err != nil {
+			log.With("tag", tag).Errorf("Error parsing cache file during tag index migration: %s", err)
+			continue
+		}
+		if err := idx.Put(tag, desc); err != nil {
+			log.With("tag", tag).Errorf("Error migrating tag into tag index: %s", err)
+		}
+	}
+
+	indexed, err := idx.Tags()
+	if err != nil {
+		return fmt.Errorf("list indexed tags: %s", err)
+	}
+	for _, tag := range indexed {
+		if onDisk[tag] {
+			continue
+		}
+		if _, _, err := idx.Delete(tag); err != nil {
+			log.With("tag", tag).Errorf("Error pruning stale tag from tag index: %s", err)
+		}
+	}
+	return nil
+}
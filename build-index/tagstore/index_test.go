@@ -0,0 +1,212 @@
+package tagstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.uber.internal/infra/kraken/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBoltTagIndex creates a boltTagIndex backed by a temp file. The
+// returned cleanup func closes the index and removes the temp dir, and
+// should be deferred by the caller.
+func newTestBoltTagIndex(t *testing.T) (idx TagIndex, cleanup func()) {
+	dir, err := ioutil.TempDir("", "tagstore_index_test")
+	require.NoError(t, err)
+
+	idx, err = NewBoltTagIndex(filepath.Join(dir, "tags.db"))
+	require.NoError(t, err)
+
+	return idx, func() {
+		idx.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMemoryTagIndexPutLookup(t *testing.T) {
+	require := require.New(t)
+
+	idx := NewMemoryTagIndex()
+	d := core.DigestFixture()
+	desc := NewTagDescriptor(d, "", 0)
+
+	require.NoError(idx.Put("repo:tag1", desc))
+	require.NoError(idx.Put("repo:tag2", desc))
+
+	tags, err := idx.Lookup(d)
+	require.NoError(err)
+	require.ElementsMatch([]string{"repo:tag1", "repo:tag2"}, tags)
+}
+
+func TestMemoryTagIndexRetagRemovesStaleReverseEntry(t *testing.T) {
+	require := require.New(t)
+
+	idx := NewMemoryTagIndex()
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	require.NoError(idx.Put("repo:tag", NewTagDescriptor(d1, "", 0)))
+	require.NoError(idx.Put("repo:tag", NewTagDescriptor(d2, "", 0)))
+
+	tags, err := idx.Lookup(d1)
+	require.NoError(err)
+	require.Empty(tags)
+
+	tags, err = idx.Lookup(d2)
+	require.NoError(err)
+	require.Equal([]string{"repo:tag"}, tags)
+}
+
+func TestMemoryTagIndexDelete(t *testing.T) {
+	require := require.New(t)
+
+	idx := NewMemoryTagIndex()
+	d := core.DigestFixture()
+	desc := NewTagDescriptor(d, "", 0)
+
+	require.NoError(idx.Put("repo:tag", desc))
+
+	deleted, found, err := idx.Delete("repo:tag")
+	require.NoError(err)
+	require.True(found)
+	require.Equal(desc, deleted)
+
+	tags, err := idx.Lookup(d)
+	require.NoError(err)
+	require.Empty(tags)
+
+	_, found, err = idx.Delete("repo:tag")
+	require.NoError(err)
+	require.False(found)
+}
+
+func TestBoltTagIndexPutLookup(t *testing.T) {
+	require := require.New(t)
+
+	idx, cleanup := newTestBoltTagIndex(t)
+	defer cleanup()
+
+	d := core.DigestFixture()
+	desc := NewTagDescriptor(d, "", 0)
+
+	require.NoError(idx.Put("repo:tag1", desc))
+	require.NoError(idx.Put("repo:tag2", desc))
+
+	tags, err := idx.Lookup(d)
+	require.NoError(err)
+	require.ElementsMatch([]string{"repo:tag1", "repo:tag2"}, tags)
+}
+
+func TestBoltTagIndexRetagRemovesStaleReverseEntry(t *testing.T) {
+	require := require.New(t)
+
+	idx, cleanup := newTestBoltTagIndex(t)
+	defer cleanup()
+
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	require.NoError(idx.Put("repo:tag", NewTagDescriptor(d1, "", 0)))
+	require.NoError(idx.Put("repo:tag", NewTagDescriptor(d2, "", 0)))
+
+	tags, err := idx.Lookup(d1)
+	require.NoError(err)
+	require.Empty(tags)
+
+	tags, err = idx.Lookup(d2)
+	require.NoError(err)
+	require.Equal([]string{"repo:tag"}, tags)
+}
+
+func TestBoltTagIndexDeleteIsAtomicAcrossBothBuckets(t *testing.T) {
+	require := require.New(t)
+
+	idx, cleanup := newTestBoltTagIndex(t)
+	defer cleanup()
+
+	d := core.DigestFixture()
+	desc := NewTagDescriptor(d, "", 0)
+
+	require.NoError(idx.Put("repo:tag", desc))
+
+	deleted, found, err := idx.Delete("repo:tag")
+	require.NoError(err)
+	require.True(found)
+	require.Equal(desc, deleted)
+
+	tags, err := idx.Lookup(d)
+	require.NoError(err)
+	require.Empty(tags)
+
+	indexed, err := idx.Tags()
+	require.NoError(err)
+	require.Empty(indexed)
+
+	_, found, err = idx.Delete("repo:tag")
+	require.NoError(err)
+	require.False(found)
+}
+
+func TestBoltTagIndexPersistsAcrossReopen(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "tagstore_index_test")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tags.db")
+
+	d := core.DigestFixture()
+	desc := NewTagDescriptor(d, "", 0)
+
+	idx, err := NewBoltTagIndex(path)
+	require.NoError(err)
+	require.NoError(idx.Put("repo:tag", desc))
+	require.NoError(idx.Close())
+
+	reopened, err := NewBoltTagIndex(path)
+	require.NoError(err)
+	defer reopened.Close()
+
+	tags, err := reopened.Lookup(d)
+	require.NoError(err)
+	require.Equal([]string{"repo:tag"}, tags)
+}
+
+func TestMigrateFileStoreCacheAddsAndPrunes(t *testing.T) {
+	require := require.New(t)
+
+	fs := newFakeFileStore()
+	idx, cleanup := newTestBoltTagIndex(t)
+	defer cleanup()
+
+	d := core.DigestFixture()
+	desc := NewTagDescriptor(d, "", 0)
+	b, err := desc.marshal()
+	require.NoError(err)
+
+	// "repo:ondisk" only exists in fs: migration should add it to idx.
+	require.NoError(fs.CreateCacheFile("repo:ondisk", bytes.NewReader(b)))
+
+	// "repo:stale" only exists in idx, simulating a crash between Delete's
+	// disk removal and its index update: migration should prune it.
+	require.NoError(idx.Put("repo:stale", desc))
+
+	require.NoError(migrateFileStoreCache(fs, idx))
+
+	tags, err := idx.Tags()
+	require.NoError(err)
+	require.Equal([]string{"repo:ondisk"}, tags)
+}
+
+func TestSplitJoinTagSet(t *testing.T) {
+	require := require.New(t)
+
+	tags := []string{"repo:a", "repo:b", "repo:c"}
+	require.Equal(tags, splitTagSet(joinTagSet(tags)))
+	require.Empty(splitTagSet(""))
+}
@@ -0,0 +1,181 @@
+package tagstore
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"code.uber.internal/infra/kraken/lib/backend"
+	"code.uber.internal/infra/kraken/lib/persistedretry/writeback"
+	"code.uber.internal/infra/kraken/utils/log"
+)
+
+// ReplicationMode controls how many backends a Put is replicated to.
+type ReplicationMode int
+
+const (
+	// ReplicationSingle replicates only to the primary backend for a tag's
+	// namespace. This is the default, and matches the pre-fan-out behavior.
+	ReplicationSingle ReplicationMode = iota
+
+	// ReplicationAll replicates to every backend whose namespace matches the
+	// tag.
+	ReplicationAll
+
+	// ReplicationQuorum replicates to a majority of the backends whose
+	// namespace matches the tag.
+	ReplicationQuorum
+)
+
+// ReplicationConfig maps a namespace to the ReplicationMode used for Puts
+// against tags in that namespace. A namespace with no entry defaults to
+// ReplicationSingle.
+type ReplicationConfig map[string]ReplicationMode
+
+func (c ReplicationConfig) mode(namespace string) ReplicationMode {
+	mode, ok := c[namespace]
+	if !ok {
+		return ReplicationSingle
+	}
+	return mode
+}
+
+// replicatePut schedules write-back of tag to whichever backends the
+// namespace's ReplicationMode dictates. Under ReplicationAll and
+// ReplicationQuorum a task is pinned to each target backend so retries land
+// on the backend that actually failed; under ReplicationSingle one unpinned
+// task is scheduled.
+func (s *tagStore) replicatePut(tag string, writeBackDelay time.Duration) error {
+	primary, err := s.backends.GetClient(tag)
+	if err != nil {
+		return fmt.Errorf("backend manager: %s", err)
+	}
+
+	clients, err := s.backends.MatchedClients(tag)
+	if err != nil || s.replication.mode(primary.Namespace()) == ReplicationSingle {
+		// Fall back to single-backend replication, either because
+		// MatchedClients found no backend for tag, or because the
+		// namespace is not configured for fan-out.
+		task := writeback.NewTaskWithDelay(tag, tag, writeBackDelay)
+		return s.writeBackManager.Add(task)
+	}
+
+	targets := clients
+	if s.replication.mode(primary.Namespace()) == ReplicationQuorum {
+		targets = quorum(clients)
+	}
+	for _, c := range targets {
+		task := writeback.NewTaskWithDelayForDestination(tag, tag, c.Namespace(), writeBackDelay)
+		if err := s.writeBackManager.Add(task); err != nil {
+			return fmt.Errorf("add write-back task for %s: %s", c.Namespace(), err)
+		}
+	}
+	return nil
+}
+
+// quorum returns a majority subset of clients.
+func quorum(clients []backend.Client) []backend.Client {
+	n := len(clients)/2 + 1
+	if n > len(clients) {
+		n = len(clients)
+	}
+	return clients[:n]
+}
+
+// backendResult is the outcome of downloading tag from a single backend,
+// used to fan results back in from the goroutines in
+// resolveDescriptorFromBackends.
+type backendResult struct {
+	client backend.Client
+	desc   TagDescriptor
+	err    error
+}
+
+// resolveDescriptorFromBackends fans a Get out to every backend whose
+// namespace matches tag, returning as soon as the first descriptor is
+// found rather than waiting on the slowest backend. Once every backend has
+// replied, a background goroutine read-repairs each one that failed to
+// return the tag, whether it replied before or after the first success, by
+// enqueueing a write-back task targeted at it.
+func (s *tagStore) resolveDescriptorFromBackends(tag string) (TagDescriptor, error) {
+	clients, err := s.backends.MatchedClients(tag)
+	if err != nil {
+		// MatchedClients found no backend for tag -- fall back to the
+		// single primary backend, which reports the same condition.
+		return s.resolveDescriptorFromBackend(tag)
+	}
+
+	results := make(chan backendResult, len(clients))
+	for _, c := range clients {
+		c := c
+		go func() {
+			var b bytes.Buffer
+			if err := c.Download(tag, &b); err != nil {
+				results <- backendResult{c, TagDescriptor{}, err}
+				return
+			}
+			desc, err := unmarshalTagDescriptor(b.Bytes())
+			results <- backendResult{c, desc, err}
+		}()
+	}
+
+	// Collect results as they arrive, returning as soon as we see the
+	// first success. The remaining in-flight requests are drained by a
+	// background goroutine, which performs read-repair once every backend
+	// has replied.
+	var found *TagDescriptor
+	var early []backendResult
+	for i := 0; i < len(clients); i++ {
+		r := <-results
+		if r.err == nil {
+			d := r.desc
+			found = &d
+			break
+		}
+		early = append(early, r)
+	}
+
+	if found == nil {
+		return TagDescriptor{}, ErrTagNotFound
+	}
+	if err := s.writeDescriptorToDisk(tag, *found); err != nil {
+		log.With("tag", tag).Errorf("Error writing tag to disk: %s", err)
+	}
+
+	remaining := len(clients) - len(early) - 1
+	go s.finishReadRepair(tag, early, results, remaining)
+
+	return *found, nil
+}
+
+// finishReadRepair drains any results still outstanding from a fan-out Get
+// and schedules read-repair write-backs against every backend which did not
+// have the tag.
+func (s *tagStore) finishReadRepair(tag string, early []backendResult, results <-chan backendResult, remaining int) {
+	var missing []backend.Client
+	for _, r := range early {
+		if r.err != nil {
+			missing = append(missing, r.client)
+		}
+	}
+	for i := 0; i < remaining; i++ {
+		r := <-results
+		if r.err != nil {
+			missing = append(missing, r.client)
+		}
+	}
+	s.readRepair(tag, missing)
+}
+
+// readRepair schedules write-back tasks against every backend in missing,
+// so the fleet eventually converges on the descriptor this instance just
+// resolved from a peer backend.
+func (s *tagStore) readRepair(tag string, missing []backend.Client) {
+	for _, c := range missing {
+		task := writeback.NewTaskWithDelayForDestination(tag, tag, c.Namespace(), 0)
+		if err := s.writeBackManager.Add(task); err != nil {
+			log.With("tag", tag, "backend", c.Namespace()).Errorf(
+				"Error scheduling read-repair write-back: %s", err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package tagstore
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"code.uber.internal/infra/kraken/core"
+	"code.uber.internal/infra/kraken/lib/backend"
+	"code.uber.internal/infra/kraken/lib/backend/backenderrors"
+
+	"github.com/stretchr/testify/require"
+)
+
+// delayedClient is a backend.Client which optionally has desc for tag, and
+// optionally blocks before responding, to exercise the "don't wait on the
+// slowest backend" behavior of resolveDescriptorFromBackends.
+type delayedClient struct {
+	namespace string
+	desc      *TagDescriptor
+	delay     time.Duration
+}
+
+func (c *delayedClient) Download(name string, dst io.Writer) error {
+	time.Sleep(c.delay)
+	if c.desc == nil {
+		return backenderrors.ErrBlobNotFound
+	}
+	b, err := c.desc.marshal()
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(b)
+	return err
+}
+
+func (c *delayedClient) Upload(name string, src io.Reader) error { return nil }
+func (c *delayedClient) Delete(name string) error                { return nil }
+func (c *delayedClient) List(prefix string) ([]string, error)    { return nil, nil }
+func (c *delayedClient) Namespace() string                       { return c.namespace }
+
+func TestResolveDescriptorFromBackendsReturnsOnFirstSuccess(t *testing.T) {
+	require := require.New(t)
+
+	d := core.DigestFixture()
+	desc := NewTagDescriptor(d, "", 0)
+
+	// Namespaces are regexps matched against the tag being fetched, so both
+	// must actually match "tag" for MatchedClients to fan out to them.
+	fast := &delayedClient{namespace: "tag.*", desc: &desc}
+	slow := &delayedClient{namespace: ".*", desc: &desc, delay: 200 * time.Millisecond}
+
+	backends, err := backend.NewManager(map[string]backend.Client{
+		fast.namespace: fast,
+		slow.namespace: slow,
+	})
+	require.NoError(err)
+
+	fs := newFakeFileStore()
+	writeBackManager := &fakeManager{}
+	s := &tagStore{
+		fs:               fs,
+		backends:         backends,
+		writeBackManager: writeBackManager,
+		tagDeleteManager: &fakeManager{},
+		index:            NewMemoryTagIndex(),
+		replication:      nil,
+	}
+
+	start := time.Now()
+	got, err := s.resolveDescriptorFromBackends("tag")
+	elapsed := time.Since(start)
+
+	require.NoError(err)
+	require.Equal(desc, got)
+	require.Less(elapsed, 100*time.Millisecond, "Get should not wait on the slow backend")
+}
+
+func TestResolveDescriptorFromBackendsReadRepairsMissingBackend(t *testing.T) {
+	require := require.New(t)
+
+	d := core.DigestFixture()
+	desc := NewTagDescriptor(d, "", 0)
+
+	// Namespaces are regexps matched against the tag being fetched, so both
+	// must actually match "tag" for MatchedClients to fan out to them.
+	have := &delayedClient{namespace: "tag.*", desc: &desc}
+	missing := &delayedClient{namespace: ".*"}
+
+	backends, err := backend.NewManager(map[string]backend.Client{
+		have.namespace:    have,
+		missing.namespace: missing,
+	})
+	require.NoError(err)
+
+	fs := newFakeFileStore()
+	writeBackManager := &fakeManager{}
+	s := &tagStore{
+		fs:               fs,
+		backends:         backends,
+		writeBackManager: writeBackManager,
+		tagDeleteManager: &fakeManager{},
+		index:            NewMemoryTagIndex(),
+		replication:      nil,
+	}
+
+	_, err = s.resolveDescriptorFromBackends("tag")
+	require.NoError(err)
+
+	require.Eventually(func() bool {
+		writeBackManager.mu.Lock()
+		defer writeBackManager.mu.Unlock()
+		return len(writeBackManager.tasks) == 1
+	}, time.Second, 10*time.Millisecond, "read-repair write-back should eventually be scheduled")
+}
+
+func TestQuorum(t *testing.T) {
+	require := require.New(t)
+
+	clients := []backend.Client{
+		&delayedClient{namespace: "a"},
+		&delayedClient{namespace: "b"},
+		&delayedClient{namespace: "c"},
+	}
+	require.Len(quorum(clients), 2)
+	require.Len(quorum(clients[:1]), 1)
+}
@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"time"
 
 	"code.uber.internal/infra/kraken/core"
+	"code.uber.internal/infra/kraken/core/tagref"
 	"code.uber.internal/infra/kraken/lib/backend"
 	"code.uber.internal/infra/kraken/lib/backend/backenderrors"
 	"code.uber.internal/infra/kraken/lib/persistedretry"
-	"code.uber.internal/infra/kraken/lib/persistedretry/writeback"
+	"code.uber.internal/infra/kraken/lib/persistedretry/tagdelete"
 	"code.uber.internal/infra/kraken/lib/store"
 	"code.uber.internal/infra/kraken/lib/store/metadata"
 	"code.uber.internal/infra/kraken/utils/log"
@@ -28,31 +30,72 @@ var (
 // FileStore defines operations required for storing tags on disk.
 type FileStore interface {
 	CreateCacheFile(name string, r io.Reader) error
+	DeleteCacheFile(name string) error
 	SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error)
 	GetCacheFileReader(name string) (store.FileReader, error)
+	ListCacheFiles() ([]string, error)
 }
 
 // Store defines tag storage operations.
 type Store interface {
 	Put(tag string, d core.Digest, writeBackDelay time.Duration) error
 	Get(tag string) (core.Digest, error)
+	PutDescriptor(tag string, desc TagDescriptor, writeBackDelay time.Duration) error
+	GetDescriptor(tag string) (TagDescriptor, error)
+	Delete(tag string) error
+	List(prefix string) ([]string, error)
+	Lookup(d core.Digest) ([]string, error)
 }
 
 // tagStore encapsulates two-level tag storage:
 // 1. On-disk file store: persists tags for availability / write-back purposes.
 // 2. Remote storage: durable tag storage.
+//
+// The reverse (digest -> tag set) index needed for Lookup lives in a
+// separate TagIndex, since it must be updated atomically with the forward
+// map and FileStore's one-file-per-tag layout cannot offer that.
 type tagStore struct {
 	fs               FileStore
 	backends         *backend.Manager
 	writeBackManager persistedretry.Manager
+	tagDeleteManager persistedretry.Manager
+	index            TagIndex
+	replication      ReplicationConfig
 }
 
-// New creates a new Store.
+// New creates a new Store backed by a BoltDB TagIndex at boltDBPath. On
+// first run against an existing deployment, it migrates any tags cached in
+// fs into the index.
 func New(
 	stats tally.Scope,
 	fs FileStore,
 	backends *backend.Manager,
-	writeBackManager persistedretry.Manager) Store {
+	writeBackManager persistedretry.Manager,
+	tagDeleteManager persistedretry.Manager,
+	replication ReplicationConfig,
+	boltDBPath string) (Store, error) {
+
+	index, err := NewBoltTagIndex(filepath.Clean(boltDBPath))
+	if err != nil {
+		return nil, fmt.Errorf("new bolt tag index: %s", err)
+	}
+	if err := migrateFileStoreCache(fs, index); err != nil {
+		return nil, fmt.Errorf("migrate file store cache into tag index: %s", err)
+	}
+	return NewWithIndex(stats, fs, backends, writeBackManager, tagDeleteManager, replication, index), nil
+}
+
+// NewWithIndex creates a new Store using the given TagIndex, bypassing the
+// BoltDB-specific setup in New. This is primarily useful for injecting an
+// in-memory TagIndex in tests.
+func NewWithIndex(
+	stats tally.Scope,
+	fs FileStore,
+	backends *backend.Manager,
+	writeBackManager persistedretry.Manager,
+	tagDeleteManager persistedretry.Manager,
+	replication ReplicationConfig,
+	index TagIndex) Store {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "tagstore",
@@ -62,83 +105,165 @@ func New(
 		fs:               fs,
 		backends:         backends,
 		writeBackManager: writeBackManager,
+		tagDeleteManager: tagDeleteManager,
+		index:            index,
+		replication:      replication,
 	}
 }
 
 func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration) error {
-	if err := s.writeTagToDisk(tag, d); err != nil {
+	return s.PutDescriptor(tag, NewTagDescriptor(d, "", 0), writeBackDelay)
+}
+
+func (s *tagStore) Get(tag string) (core.Digest, error) {
+	desc, err := s.GetDescriptor(tag)
+	if err != nil {
+		return core.Digest{}, err
+	}
+	return desc.Digest, nil
+}
+
+func (s *tagStore) PutDescriptor(tag string, desc TagDescriptor, writeBackDelay time.Duration) error {
+	if _, err := tagref.ParseTagRef(tag); err != nil {
+		return err
+	}
+	if err := s.writeDescriptorToDisk(tag, desc); err != nil {
 		return fmt.Errorf("write tag to disk: %s", err)
 	}
 	if _, err := s.fs.SetCacheFileMetadata(tag, metadata.NewPersist(true)); err != nil {
 		return fmt.Errorf("set persist metadata: %s", err)
 	}
-	task := writeback.NewTaskWithDelay(tag, tag, writeBackDelay)
-	if err := s.writeBackManager.Add(task); err != nil {
-		return fmt.Errorf("add write-back task: %s", err)
+	if err := s.replicatePut(tag, writeBackDelay); err != nil {
+		return fmt.Errorf("replicate put: %s", err)
+	}
+	if err := s.index.Put(tag, desc); err != nil {
+		return fmt.Errorf("put tag index: %s", err)
 	}
 	return nil
 }
 
-func (s *tagStore) Get(tag string) (d core.Digest, err error) {
-	for _, resolve := range []func(tag string) (core.Digest, error){
-		s.resolveFromDisk,
-		s.resolveFromBackend,
+func (s *tagStore) GetDescriptor(tag string) (desc TagDescriptor, err error) {
+	for _, resolve := range []func(tag string) (TagDescriptor, error){
+		s.resolveDescriptorFromDisk,
+		s.resolveDescriptorFromBackends,
 	} {
-		d, err = resolve(tag)
+		desc, err = resolve(tag)
 		if err == ErrTagNotFound {
 			continue
 		}
 		break
 	}
-	return d, err
+	return desc, err
+}
+
+// Delete removes tag from the local cache and schedules a write-back
+// deletion against the backend so the remote store stays consistent.
+func (s *tagStore) Delete(tag string) error {
+	if _, err := tagref.ParseTagRef(tag); err != nil {
+		return err
+	}
+	if err := s.fs.DeleteCacheFile(tag); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete tag from disk: %s", err)
+	}
+	task := tagdelete.NewTask(tag, tag)
+	if err := s.tagDeleteManager.Add(task); err != nil {
+		return fmt.Errorf("add tag-delete task: %s", err)
+	}
+	if _, _, err := s.index.Delete(tag); err != nil {
+		return fmt.Errorf("delete tag index: %s", err)
+	}
+	return nil
 }
 
-func (s *tagStore) writeTagToDisk(tag string, d core.Digest) error {
-	buf := bytes.NewBufferString(d.String())
-	if err := s.fs.CreateCacheFile(tag, buf); err != nil && !os.IsExist(err) {
+// List enumerates all tags with the given prefix, de-duplicating results
+// from the backend with whatever is in the local cache.
+func (s *tagStore) List(prefix string) ([]string, error) {
+	seen := make(map[string]bool)
+	var tags []string
+
+	backendClient, err := s.backends.GetClient(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("backend manager: %s", err)
+	}
+	backendTags, err := backendClient.List(prefix)
+	if err != nil {
+		log.With("prefix", prefix).Errorf("Error listing tags from backend: %s", err)
+	}
+	for _, tag := range backendTags {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	cacheTags, err := s.fs.ListCacheFiles()
+	if err != nil {
+		return nil, fmt.Errorf("list cache files: %s", err)
+	}
+	for _, tag := range cacheTags {
+		if len(tag) >= len(prefix) && tag[:len(prefix)] == prefix && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// Lookup returns all tags which currently point at d.
+func (s *tagStore) Lookup(d core.Digest) ([]string, error) {
+	return s.index.Lookup(d)
+}
+
+func (s *tagStore) writeDescriptorToDisk(tag string, desc TagDescriptor) error {
+	b, err := desc.marshal()
+	if err != nil {
+		return err
+	}
+	if err := s.fs.CreateCacheFile(tag, bytes.NewReader(b)); err != nil && !os.IsExist(err) {
 		return err
 	}
 	return nil
 }
 
-func (s *tagStore) resolveFromDisk(tag string) (core.Digest, error) {
+func (s *tagStore) resolveDescriptorFromDisk(tag string) (TagDescriptor, error) {
 	f, err := s.fs.GetCacheFileReader(tag)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return core.Digest{}, ErrTagNotFound
+			return TagDescriptor{}, ErrTagNotFound
 		}
-		return core.Digest{}, fmt.Errorf("fs: %s", err)
+		return TagDescriptor{}, fmt.Errorf("fs: %s", err)
 	}
 	defer f.Close()
 	var b bytes.Buffer
 	if _, err := io.Copy(&b, f); err != nil {
-		return core.Digest{}, fmt.Errorf("copy from fs: %s", err)
+		return TagDescriptor{}, fmt.Errorf("copy from fs: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(b.String())
+	desc, err := unmarshalTagDescriptor(b.Bytes())
 	if err != nil {
-		return core.Digest{}, fmt.Errorf("parse fs digest: %s", err)
+		return TagDescriptor{}, fmt.Errorf("parse fs tag descriptor: %s", err)
 	}
-	return d, nil
+	return desc, nil
 }
 
-func (s *tagStore) resolveFromBackend(tag string) (core.Digest, error) {
+func (s *tagStore) resolveDescriptorFromBackend(tag string) (TagDescriptor, error) {
 	backendClient, err := s.backends.GetClient(tag)
 	if err != nil {
-		return core.Digest{}, fmt.Errorf("backend manager: %s", err)
+		return TagDescriptor{}, fmt.Errorf("backend manager: %s", err)
 	}
 	var b bytes.Buffer
 	if err := backendClient.Download(tag, &b); err != nil {
 		if err == backenderrors.ErrBlobNotFound {
-			return core.Digest{}, ErrTagNotFound
+			return TagDescriptor{}, ErrTagNotFound
 		}
-		return core.Digest{}, fmt.Errorf("backend client: %s", err)
+		return TagDescriptor{}, fmt.Errorf("backend client: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(b.String())
+	desc, err := unmarshalTagDescriptor(b.Bytes())
 	if err != nil {
-		return core.Digest{}, fmt.Errorf("parse backend digest: %s", err)
+		return TagDescriptor{}, fmt.Errorf("parse backend tag descriptor: %s", err)
 	}
-	if err := s.writeTagToDisk(tag, d); err != nil {
+	if err := s.writeDescriptorToDisk(tag, desc); err != nil {
 		log.With("tag", tag).Errorf("Error writing tag to disk: %s", err)
 	}
-	return d, nil
+	return desc, nil
 }
@@ -0,0 +1,182 @@
+package tagstore
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"code.uber.internal/infra/kraken/core"
+	"code.uber.internal/infra/kraken/lib/backend"
+	"code.uber.internal/infra/kraken/lib/backend/backenderrors"
+	"code.uber.internal/infra/kraken/lib/persistedretry"
+	"code.uber.internal/infra/kraken/lib/store"
+	"code.uber.internal/infra/kraken/lib/store/metadata"
+
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// fakeFileReader adapts a bytes.Reader to whatever minimal interface
+// store.FileReader exposes to callers in this package (Read + Close).
+type fakeFileReader struct {
+	*bytes.Reader
+}
+
+func (f *fakeFileReader) Close() error { return nil }
+
+// fakeFileStore is an in-memory FileStore, for tests.
+type fakeFileStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newFakeFileStore() *fakeFileStore {
+	return &fakeFileStore{files: make(map[string][]byte)}
+}
+
+func (fs *fakeFileStore) CreateCacheFile(name string, r io.Reader) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.files[name]; ok {
+		return os.ErrExist
+	}
+	var b bytes.Buffer
+	if _, err := io.Copy(&b, r); err != nil {
+		return err
+	}
+	fs.files[name] = b.Bytes()
+	return nil
+}
+
+func (fs *fakeFileStore) DeleteCacheFile(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.files[name]; !ok {
+		return os.ErrNotExist
+	}
+	delete(fs.files, name)
+	return nil
+}
+
+func (fs *fakeFileStore) SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error) {
+	return true, nil
+}
+
+func (fs *fakeFileStore) GetCacheFileReader(name string) (store.FileReader, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	b, ok := fs.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &fakeFileReader{bytes.NewReader(b)}, nil
+}
+
+func (fs *fakeFileStore) ListCacheFiles() ([]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var names []string
+	for name := range fs.files {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// fakeManager is a persistedretry.Manager which just records added tasks.
+type fakeManager struct {
+	mu    sync.Mutex
+	tasks []persistedretry.Task
+}
+
+func (m *fakeManager) Add(task persistedretry.Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks = append(m.tasks, task)
+	return nil
+}
+
+// noopClient is a backend.Client which never has anything, for tests which
+// only exercise the local-cache path.
+type noopClient struct {
+	namespace string
+}
+
+func newNoopClient(namespace string) *noopClient {
+	return &noopClient{namespace}
+}
+
+func (c *noopClient) Download(name string, dst io.Writer) error { return backenderrors.ErrBlobNotFound }
+func (c *noopClient) Upload(name string, src io.Reader) error   { return nil }
+func (c *noopClient) Delete(name string) error                  { return nil }
+func (c *noopClient) List(prefix string) ([]string, error)      { return nil, nil }
+func (c *noopClient) Namespace() string                         { return c.namespace }
+
+// listClient is a noopClient whose List returns a fixed set of tags.
+type listClient struct {
+	*noopClient
+	tags []string
+}
+
+func (c *listClient) List(prefix string) ([]string, error) { return c.tags, nil }
+
+func newTestStore(t *testing.T) (Store, *fakeFileStore, *fakeManager, *fakeManager) {
+	fs := newFakeFileStore()
+	writeBackManager := &fakeManager{}
+	tagDeleteManager := &fakeManager{}
+
+	backends, err := backend.NewManager(map[string]backend.Client{
+		".*": newNoopClient("origin"),
+	})
+	require.NoError(t, err)
+
+	stats := tally.NewTestScope("", nil)
+	store := NewWithIndex(stats, fs, backends, writeBackManager, tagDeleteManager, nil, NewMemoryTagIndex())
+	return store, fs, writeBackManager, tagDeleteManager
+}
+
+func TestStoreListDedupesDiskAndBackend(t *testing.T) {
+	require := require.New(t)
+
+	fs := newFakeFileStore()
+	backends, err := backend.NewManager(map[string]backend.Client{
+		".*": &listClient{newNoopClient("origin"), []string{"repo:a", "repo:c"}},
+	})
+	require.NoError(err)
+	store := NewWithIndex(
+		tally.NewTestScope("", nil), fs, backends, &fakeManager{}, &fakeManager{}, nil, NewMemoryTagIndex())
+
+	// "repo:a" is both on disk and in the backend, and must appear once.
+	d := core.DigestFixture()
+	require.NoError(store.Put("repo:a", d, 0))
+	require.NoError(fs.CreateCacheFile("repo:b", bytes.NewReader([]byte(d.String()))))
+
+	tags, err := store.List("repo:")
+	require.NoError(err)
+	require.ElementsMatch([]string{"repo:a", "repo:b", "repo:c"}, tags)
+}
+
+func TestStoreDeleteRemovesFromDiskAndIndex(t *testing.T) {
+	require := require.New(t)
+
+	store, _, _, tagDeleteManager := newTestStore(t)
+
+	d := core.DigestFixture()
+	require.NoError(store.Put("repo:a", d, 0))
+	require.NoError(store.Delete("repo:a"))
+
+	_, err := store.Get("repo:a")
+	require.Equal(ErrTagNotFound, err)
+
+	tags, err := store.Lookup(d)
+	require.NoError(err)
+	require.Empty(tags)
+
+	require.Len(tagDeleteManager.tasks, 1)
+}
@@ -0,0 +1,85 @@
+// Package tagref implements the Docker/OCI distribution grammar for tag
+// references and flags the handful of strings that are syntactically legal
+// but semantically wrong for a tag, such as a bare digest or an algorithm
+// name, which would otherwise collide with tagstore's own encoding.
+package tagref
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"code.uber.internal/infra/kraken/core"
+)
+
+// reservedAlgorithms are digest algorithm names which must not be used as a
+// bare tag, since they would be ambiguous with a digest's algorithm prefix.
+var reservedAlgorithms = map[string]bool{
+	"sha256": true,
+	"sha512": true,
+}
+
+// nameComponentRegexp matches a single repository name component, per the
+// Docker distribution grammar (e.g. "library" in "library/ubuntu").
+var nameComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*$`)
+
+// tagRegexp matches a tag component, per the Docker distribution grammar.
+var tagRegexp = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+// Ref is a validated tag reference, split into its repository and tag
+// components.
+type Ref struct {
+	Repository string
+	Tag        string
+}
+
+func (r Ref) String() string {
+	return r.Repository + ":" + r.Tag
+}
+
+// ErrInvalidTagRef indicates that a raw string is not a valid tag reference.
+type ErrInvalidTagRef struct {
+	Ref    string
+	Reason string
+}
+
+func (e *ErrInvalidTagRef) Error() string {
+	return fmt.Sprintf("invalid tag ref %q: %s", e.Ref, e.Reason)
+}
+
+// ParseTagRef parses and validates raw as a tag reference of the form
+// "repository:tag". It rejects raw if it parses as a digest, if its tag
+// component is a reserved digest algorithm name, or if either component
+// does not conform to the Docker distribution grammar.
+func ParseTagRef(raw string) (Ref, error) {
+	if _, err := core.ParseSHA256Digest(raw); err == nil {
+		return Ref{}, &ErrInvalidTagRef{raw, "looks like a digest, not a tag"}
+	}
+
+	repo, tag := splitRepoTag(raw)
+	if repo == "" || tag == "" {
+		return Ref{}, &ErrInvalidTagRef{raw, "must be of the form repository:tag"}
+	}
+	if reservedAlgorithms[tag] {
+		return Ref{}, &ErrInvalidTagRef{raw, fmt.Sprintf("%q is a reserved digest algorithm name", tag)}
+	}
+	for _, component := range strings.Split(repo, "/") {
+		if !nameComponentRegexp.MatchString(component) {
+			return Ref{}, &ErrInvalidTagRef{raw, fmt.Sprintf("invalid repository name component %q", component)}
+		}
+	}
+	if !tagRegexp.MatchString(tag) {
+		return Ref{}, &ErrInvalidTagRef{raw, fmt.Sprintf("invalid tag %q", tag)}
+	}
+	return Ref{Repository: repo, Tag: tag}, nil
+}
+
+// splitRepoTag splits raw on its last colon into a repository and tag. If
+// raw contains no colon, the tag is empty.
+func splitRepoTag(raw string) (repo, tag string) {
+	i := strings.LastIndex(raw, ":")
+	if i < 0 {
+		return raw, ""
+	}
+	return raw[:i], raw[i+1:]
+}
@@ -0,0 +1,49 @@
+package tagref
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTagRefValid(t *testing.T) {
+	tests := []struct {
+		raw  string
+		repo string
+		tag  string
+	}{
+		{"library/ubuntu:latest", "library/ubuntu", "latest"},
+		{"foo/bar:1.0.0", "foo/bar", "1.0.0"},
+		{"foo:sha256-abc", "foo", "sha256-abc"},
+	}
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			require := require.New(t)
+
+			ref, err := ParseTagRef(test.raw)
+			require.NoError(err)
+			require.Equal(test.repo, ref.Repository)
+			require.Equal(test.tag, ref.Tag)
+		})
+	}
+}
+
+func TestParseTagRefInvalid(t *testing.T) {
+	tests := []string{
+		"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"library/ubuntu:sha256",
+		"library/ubuntu:sha512",
+		"noTag",
+		"library/ubuntu:",
+		":latest",
+		"Library/ubuntu:latest",
+		"library/ubuntu:-latest",
+	}
+	for _, raw := range tests {
+		t.Run(raw, func(t *testing.T) {
+			_, err := ParseTagRef(raw)
+			require.Error(t, err)
+			require.IsType(t, &ErrInvalidTagRef{}, err)
+		})
+	}
+}
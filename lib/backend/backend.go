@@ -0,0 +1,94 @@
+// Package backend provides a uniform Client interface over whatever remote
+// storage a given namespace is configured against (S3, HDFS, another
+// kraken origin cluster, etc), and a Manager which routes a name to the
+// backend(s) configured for its namespace.
+package backend
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+)
+
+// Client defines operations against a single remote backend.
+type Client interface {
+	Download(name string, dst io.Writer) error
+	Upload(name string, src io.Reader) error
+	Delete(name string) error
+	List(prefix string) ([]string, error)
+
+	// Namespace returns the namespace pattern this client was configured
+	// under. Used to key write-back retries and replication policy to a
+	// specific backend.
+	Namespace() string
+}
+
+type namespaceClient struct {
+	namespace string
+	pattern   *regexp.Regexp
+	client    Client
+}
+
+// Manager routes a name (tag, blob digest, etc) to the Client(s) whose
+// namespace pattern matches it.
+type Manager struct {
+	clients []namespaceClient
+}
+
+// NewManager creates a Manager from a set of namespace regexp -> Client.
+// A name may match more than one namespace, in which case all are
+// considered configured for that name. Clients are kept in lexical order of
+// their namespace pattern.
+func NewManager(namespaces map[string]Client) (*Manager, error) {
+	var clients []namespaceClient
+	for namespace, client := range namespaces {
+		pattern, err := regexp.Compile(namespace)
+		if err != nil {
+			return nil, fmt.Errorf("compile namespace regexp %q: %s", namespace, err)
+		}
+		clients = append(clients, namespaceClient{namespace, pattern, client})
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].namespace < clients[j].namespace
+	})
+	return &Manager{clients}, nil
+}
+
+// GetClient returns the first Client whose namespace matches name.
+func (m *Manager) GetClient(name string) (Client, error) {
+	for _, nc := range m.clients {
+		if nc.pattern.MatchString(name) {
+			return nc.client, nil
+		}
+	}
+	return nil, fmt.Errorf("no backend configured for %q", name)
+}
+
+// MatchedClients returns every Client whose namespace matches name, in a
+// deterministic order. Used for fan-out reads/writes across all backends
+// which could plausibly own name.
+func (m *Manager) MatchedClients(name string) ([]Client, error) {
+	var matched []Client
+	for _, nc := range m.clients {
+		if nc.pattern.MatchString(name) {
+			matched = append(matched, nc.client)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no backend configured for %q", name)
+	}
+	return matched, nil
+}
+
+// GetClientForNamespace returns the Client registered under the exact
+// namespace pattern string namespace. Used to pin a retry to the specific
+// backend it originally failed against.
+func (m *Manager) GetClientForNamespace(namespace string) (Client, error) {
+	for _, nc := range m.clients {
+		if nc.namespace == namespace {
+			return nc.client, nil
+		}
+	}
+	return nil, fmt.Errorf("no backend registered for namespace %q", namespace)
+}
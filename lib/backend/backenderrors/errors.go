@@ -0,0 +1,9 @@
+// Package backenderrors defines errors shared across backend.Client
+// implementations.
+package backenderrors
+
+import "errors"
+
+// ErrBlobNotFound is returned by a backend Client when the requested name
+// does not exist in that backend.
+var ErrBlobNotFound = errors.New("blob not found")
@@ -0,0 +1,24 @@
+// Package persistedretry provides a generic framework for scheduling tasks
+// which must be persisted to disk and retried until they succeed, so a
+// process restart cannot silently drop a pending operation against a
+// remote backend.
+package persistedretry
+
+import "time"
+
+// Task is a unit of work that is persisted and retried until it succeeds.
+type Task interface {
+	GetLastAttempt() time.Time
+	Ready() bool
+	Expired(ttl time.Duration) bool
+}
+
+// Executor executes a Task against whatever remote system it targets.
+type Executor interface {
+	Exec(task Task) error
+}
+
+// Manager schedules retries of persisted Tasks until they succeed.
+type Manager interface {
+	Add(task Task) error
+}
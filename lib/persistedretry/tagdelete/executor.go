@@ -0,0 +1,44 @@
+package tagdelete
+
+import (
+	"fmt"
+
+	"code.uber.internal/infra/kraken/lib/backend"
+	"code.uber.internal/infra/kraken/lib/persistedretry"
+)
+
+// Executor deletes the tag named by a Task from its destination backend.
+type Executor struct {
+	backends *backend.Manager
+}
+
+// NewExecutor creates a new Executor.
+func NewExecutor(backends *backend.Manager) *Executor {
+	return &Executor{backends}
+}
+
+var _ persistedretry.Executor = (*Executor)(nil)
+
+// Exec deletes task's tag from its destination backend, or from whichever
+// backend matches task.Namespace if no destination was pinned.
+func (e *Executor) Exec(task persistedretry.Task) error {
+	t, ok := task.(*Task)
+	if !ok {
+		return fmt.Errorf("expected *tagdelete.Task, got %T", task)
+	}
+	client, err := e.destinationClient(t)
+	if err != nil {
+		return fmt.Errorf("resolve destination backend: %s", err)
+	}
+	if err := client.Delete(t.Name); err != nil {
+		return fmt.Errorf("delete: %s", err)
+	}
+	return nil
+}
+
+func (e *Executor) destinationClient(task *Task) (backend.Client, error) {
+	if task.Destination != "" {
+		return e.backends.GetClientForNamespace(task.Destination)
+	}
+	return e.backends.GetClient(task.Namespace)
+}
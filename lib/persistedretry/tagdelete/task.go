@@ -0,0 +1,70 @@
+// Package tagdelete defines a persisted-retry task for deleting tags from
+// remote backends. It mirrors the shape of writeback.Task so tag deletions
+// get the same crash-safe, retry-until-success semantics as tag writes.
+package tagdelete
+
+import (
+	"fmt"
+	"time"
+)
+
+// Task contains the information required to delete a tag from a remote
+// backend. Tasks are persisted to disk so a delete which fails (e.g. due to
+// a transient backend outage) is retried until it succeeds, rather than
+// silently leaving the remote store out of sync with the local cache.
+type Task struct {
+	Namespace   string    `db:"namespace"`
+	Name        string    `db:"name"`
+	Destination string    `db:"destination"`
+	CreatedAt   time.Time `db:"created_at"`
+	LastAttempt time.Time `db:"last_attempt"`
+	Failures    int       `db:"failures"`
+	Delay       time.Duration
+}
+
+// NewTask creates a new Task.
+func NewTask(namespace, name string) *Task {
+	return NewTaskWithDelay(namespace, name, 0)
+}
+
+// NewTaskWithDelay creates a new Task which does not become ready for
+// execution until delay has passed.
+func NewTaskWithDelay(namespace, name string, delay time.Duration) *Task {
+	return NewTaskWithDelayForDestination(namespace, name, "", delay)
+}
+
+// NewTaskWithDelayForDestination creates a new Task which does not become
+// ready for execution until delay has passed, and which is pinned to the
+// given destination backend namespace rather than whichever backend
+// Namespace would otherwise resolve to.
+func NewTaskWithDelayForDestination(namespace, name, destination string, delay time.Duration) *Task {
+	now := time.Now()
+	return &Task{
+		Namespace:   namespace,
+		Name:        name,
+		Destination: destination,
+		CreatedAt:   now,
+		LastAttempt: now,
+		Delay:       delay,
+	}
+}
+
+// GetLastAttempt returns when t was last attempted.
+func (t *Task) GetLastAttempt() time.Time {
+	return t.LastAttempt
+}
+
+// Ready returns whether t is ready to be retried.
+func (t *Task) Ready() bool {
+	return time.Since(t.CreatedAt) >= t.Delay
+}
+
+// Expired always returns false -- tag deletes must eventually succeed, else
+// the remote backend will diverge from the local cache forever.
+func (t *Task) Expired(ttl time.Duration) bool {
+	return false
+}
+
+func (t *Task) String() string {
+	return fmt.Sprintf("tagdelete.Task(namespace=%s, name=%s)", t.Namespace, t.Name)
+}
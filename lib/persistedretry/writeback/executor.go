@@ -0,0 +1,64 @@
+package writeback
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"code.uber.internal/infra/kraken/lib/backend"
+	"code.uber.internal/infra/kraken/lib/persistedretry"
+)
+
+// Store provides the local content a write-back Task needs to upload.
+type Store interface {
+	GetCacheFileReader(name string) (io.ReadCloser, error)
+}
+
+// Executor uploads the local content named by a Task to its destination
+// backend.
+type Executor struct {
+	backends *backend.Manager
+	store    Store
+}
+
+// NewExecutor creates a new Executor.
+func NewExecutor(backends *backend.Manager, store Store) *Executor {
+	return &Executor{backends, store}
+}
+
+var _ persistedretry.Executor = (*Executor)(nil)
+
+// Exec uploads the content for task to its destination backend, or to
+// whichever backend matches task.Namespace if no destination was pinned.
+func (e *Executor) Exec(task persistedretry.Task) error {
+	t, ok := task.(*Task)
+	if !ok {
+		return fmt.Errorf("expected *writeback.Task, got %T", task)
+	}
+	f, err := e.store.GetCacheFileReader(t.Name)
+	if err != nil {
+		return fmt.Errorf("get cache file reader: %s", err)
+	}
+	defer f.Close()
+
+	var b bytes.Buffer
+	if _, err := io.Copy(&b, f); err != nil {
+		return fmt.Errorf("read cache file: %s", err)
+	}
+
+	client, err := e.destinationClient(t)
+	if err != nil {
+		return fmt.Errorf("resolve destination backend: %s", err)
+	}
+	if err := client.Upload(t.Name, bytes.NewReader(b.Bytes())); err != nil {
+		return fmt.Errorf("upload: %s", err)
+	}
+	return nil
+}
+
+func (e *Executor) destinationClient(task *Task) (backend.Client, error) {
+	if task.Destination != "" {
+		return e.backends.GetClientForNamespace(task.Destination)
+	}
+	return e.backends.GetClient(task.Namespace)
+}
@@ -0,0 +1,21 @@
+// Package metadata defines metadata that can be attached to a cache file.
+package metadata
+
+// Metadata is a piece of metadata attached to a cache file.
+type Metadata interface {
+	GetSuffix() string
+}
+
+type persist struct {
+	shouldPersist bool
+}
+
+// NewPersist creates Metadata marking whether a cache file should survive
+// cache eviction.
+func NewPersist(shouldPersist bool) Metadata {
+	return &persist{shouldPersist}
+}
+
+func (p *persist) GetSuffix() string {
+	return "_persist"
+}
@@ -0,0 +1,10 @@
+// Package store provides local, on-disk storage for blobs and their
+// metadata.
+package store
+
+import "io"
+
+// FileReader reads a cache file's content.
+type FileReader interface {
+	io.ReadCloser
+}